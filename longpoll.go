@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// WaitPopper is implemented by Stores that can block a caller until a
+// task becomes ready rather than returning empty-handed immediately.
+// MemStore implements it via Queue's notify channel; Stores that don't
+// (e.g. RedisStore) get a short-poll fallback from QueueManager.PopWait.
+// Every call must return promptly once ctx is canceled, so a disconnected
+// long-poll or SSE client doesn't leave the wait running in the background.
+type WaitPopper interface {
+	PopWait(ctx context.Context, queueName string, timeout time.Duration) (*Task, string, error)
+}
+
+func (s *MemStore) PopWait(ctx context.Context, queueName string, timeout time.Duration) (*Task, string, error) {
+	task, lease := s.getOrCreate(queueName).PopWait(ctx, timeout)
+	return task, lease, nil
+}
+
+// PopWait pops from queueName, waiting up to timeout for a task to become
+// ready if none is available immediately. A nil task (not an error) means
+// the wait timed out or ctx was canceled first.
+func (qm *QueueManager) PopWait(ctx context.Context, queueName string, timeout time.Duration) (*Task, string, error) {
+	if waiter, ok := qm.store.(WaitPopper); ok {
+		return waiter.PopWait(ctx, queueName, timeout)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		task, lease, err := qm.store.Pop(queueName)
+		if err != nil || task != nil {
+			return task, lease, err
+		}
+		if time.Now().After(deadline) {
+			return nil, "", nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, "", nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -1,90 +1,34 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"sync"
+	"os"
+	"time"
 )
 
-type Task struct {
-	Body     string `json:"body"`
-	Priority string `json:"priority"` // "low", "medium", "high"
-}
-
-// A single queue with priority levels
-type Queue struct {
-	High   []Task
-	Medium []Task
-	Low    []Task
-	mu     sync.Mutex
-}
+var manager *QueueManager
 
-// Add a task to the queue based on its priority
-func (q *Queue) Push(task Task) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
-	// Default priority is "low"
-	switch task.Priority {
-	case "high":
-		q.High = append(q.High, task)
-	case "medium":
-		q.Medium = append(q.Medium, task)
-	default:
-		q.Low = append(q.Low, task)
+// managerFromEnv builds the QueueManager's Store from QUEUE_STORE/
+// REDIS_ADDR, defaulting to the in-memory store when QUEUE_STORE isn't
+// "redis".
+func managerFromEnv() *QueueManager {
+	if os.Getenv("QUEUE_STORE") != "redis" {
+		return NewQueueManager()
 	}
-}
-
-// Pop a task based on priority (high > medium > low)
-func (q *Queue) Pop() *Task {
-	q.mu.Lock()
-	defer q.mu.Unlock()
 
-	if len(q.High) > 0 {
-		task := q.High[0]
-		q.High = q.High[1:]
-		return &task
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
 	}
-	if len(q.Medium) > 0 {
-		task := q.Medium[0]
-		q.Medium = q.Medium[1:]
-		return &task
-	}
-	if len(q.Low) > 0 {
-		task := q.Low[0]
-		q.Low = q.Low[1:]
-		return &task
-	}
-	return nil // No tasks available
-}
-
-// Central queue manager that manages multiple named queues
-type QueueManager struct {
-	Queues map[string]*Queue
-	mu     sync.RWMutex
+	return NewQueueManager(WithStore(NewRedisStore(addr)))
 }
 
-func NewQueueManager() *QueueManager {
-	return &QueueManager{
-		Queues: make(map[string]*Queue),
-	}
-}
-
-// Get or create a queue by name
-func (qm *QueueManager) GetQueue(queueName string) *Queue {
-	qm.mu.Lock()
-	defer qm.mu.Unlock()
-
-	if _, exists := qm.Queues[queueName]; !exists {
-		qm.Queues[queueName] = &Queue{}
-	}
-	return qm.Queues[queueName]
-}
-
-var manager = NewQueueManager()
-
 // HTTP handler to push a task to the queue
 func pushTaskHandler(w http.ResponseWriter, r *http.Request) {
 	var task Task
@@ -106,15 +50,51 @@ func pushTaskHandler(w http.ResponseWriter, r *http.Request) {
 		task.Priority = "low"
 	}
 
+	// A ?delay= query param is a convenience for setting Task.Delay without
+	// a JSON body field, e.g. for curl-driven testing.
+	if task.Delay == 0 && task.ETA.IsZero() {
+		if raw := r.URL.Query().Get("delay"); raw != "" {
+			delay, err := time.ParseDuration(raw)
+			if err != nil {
+				http.Error(w, "Invalid delay duration", http.StatusBadRequest)
+				return
+			}
+			task.Delay = delay
+		}
+	}
+
+	// A ?dedup=true query param auto-derives Name from the task body's
+	// SHA-256 hash, so identical bodies are deduplicated without the
+	// producer having to pick a name itself.
+	if task.Name == "" && r.URL.Query().Get("dedup") == "true" {
+		sum := sha256.Sum256([]byte(task.Body))
+		task.Name = hex.EncodeToString(sum[:])
+	}
+
 	// Add task to the named queue
-	queue := manager.GetQueue(queueName)
-	queue.Push(task)
+	if err := manager.PushTo(queueName, task); err != nil {
+		if errors.Is(err, ErrTaskAlreadyAdded) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to push task", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Task added to queue '%s' with priority: %s\n", queueName, task.Priority)
 }
 
-// HTTP handler to pop a task from the queue
+// popResponse wraps a popped task with the lease token needed to ack/nack it.
+type popResponse struct {
+	Task  *Task  `json:"task"`
+	Lease string `json:"lease"`
+}
+
+// HTTP handler to pop a task from the queue. A ?wait= duration (e.g.
+// "30s") makes it long-poll: if the queue is empty it blocks until a task
+// arrives or the wait elapses, at which point it reports 204 instead of
+// the usual 404 so callers can tell "timed out" from "bad queue".
 func popTaskHandler(w http.ResponseWriter, r *http.Request) {
 	queueName := r.URL.Query().Get("queue")
 	if queueName == "" {
@@ -122,21 +102,165 @@ func popTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Pop task from the named queue
-	queue := manager.GetQueue(queueName)
-	task := queue.Pop()
+	waitRaw := r.URL.Query().Get("wait")
+	var task *Task
+	var lease string
+	var err error
+	if waitRaw == "" {
+		task, lease, err = manager.PopFrom(queueName)
+	} else {
+		var wait time.Duration
+		wait, err = time.ParseDuration(waitRaw)
+		if err != nil {
+			http.Error(w, "Invalid wait duration", http.StatusBadRequest)
+			return
+		}
+		task, lease, err = manager.PopWait(r.Context(), queueName, wait)
+	}
+	if err != nil {
+		http.Error(w, "Failed to pop task", http.StatusInternalServerError)
+		return
+	}
 	if task == nil {
+		if waitRaw != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 		http.Error(w, "No tasks available in queue", http.StatusNotFound)
 		return
 	}
 
-	json.NewEncoder(w).Encode(task)
+	json.NewEncoder(w).Encode(popResponse{Task: task, Lease: lease})
+}
+
+// sseWaitTimeout bounds each long-poll iteration inside streamTaskHandler,
+// so it periodically re-checks the request context even with no traffic.
+const sseWaitTimeout = 30 * time.Second
+
+// HTTP handler that streams tasks as they become available via
+// server-sent events. Each event carries a lease token the client passes
+// to /ack or /nack, the same as a regular /pop.
+func streamTaskHandler(w http.ResponseWriter, r *http.Request) {
+	queueName := r.URL.Query().Get("queue")
+	if queueName == "" {
+		http.Error(w, "Queue query param required", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+	for ctx.Err() == nil {
+		task, lease, err := manager.PopWait(ctx, queueName, sseWaitTimeout)
+		if err != nil {
+			return
+		}
+		if task == nil {
+			continue // wait window elapsed (or ctx was canceled); loop re-checks ctx.Err()
+		}
+
+		payload, err := json.Marshal(popResponse{Task: task, Lease: lease})
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "data: %s\n\n", payload)
+		flusher.Flush()
+	}
+}
+
+// HTTP handler for a worker to report that a leased task succeeded
+func ackTaskHandler(w http.ResponseWriter, r *http.Request) {
+	queueName := r.URL.Query().Get("queue")
+	lease := r.URL.Query().Get("lease")
+	if queueName == "" || lease == "" {
+		http.Error(w, "queue and lease query params required", http.StatusBadRequest)
+		return
+	}
+
+	if err := manager.Ack(queueName, lease); err != nil {
+		http.Error(w, "Unknown or already resolved lease", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Task acked\n")
+}
+
+// HTTP handler for a worker to report that a leased task failed
+func nackTaskHandler(w http.ResponseWriter, r *http.Request) {
+	queueName := r.URL.Query().Get("queue")
+	lease := r.URL.Query().Get("lease")
+	if queueName == "" || lease == "" {
+		http.Error(w, "queue and lease query params required", http.StatusBadRequest)
+		return
+	}
+
+	if err := manager.Nack(queueName, lease); err != nil {
+		http.Error(w, "Unknown or already resolved lease", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Task nacked\n")
+}
+
+// HTTP handler to inspect a queue's dead-letter queue
+func dlqHandler(w http.ResponseWriter, r *http.Request) {
+	queueName := r.URL.Query().Get("queue")
+	if queueName == "" {
+		http.Error(w, "Queue query param required", http.StatusBadRequest)
+		return
+	}
+
+	tasks, supported, err := manager.DeadLetters(queueName)
+	if err != nil {
+		http.Error(w, "Failed to list dead letters", http.StatusInternalServerError)
+		return
+	}
+	if !supported {
+		http.Error(w, "This store does not support listing dead letters", http.StatusNotImplemented)
+		return
+	}
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// HTTP handler to report queue depth without popping anything
+func peekHandler(w http.ResponseWriter, r *http.Request) {
+	queueName := r.URL.Query().Get("queue")
+	if queueName == "" {
+		http.Error(w, "Queue query param required", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := manager.Stats(queueName)
+	if err != nil {
+		http.Error(w, "Failed to read queue stats", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(stats)
 }
 
 // Main function to start the HTTP server
 func main() {
-	http.HandleFunc("/push", pushTaskHandler) // Handle pushing tasks
-	http.HandleFunc("/pop", popTaskHandler)   // Handle popping tasks
+	manager = managerFromEnv()
+
+	http.HandleFunc("/push", pushTaskHandler)     // Handle pushing tasks
+	http.HandleFunc("/pop", popTaskHandler)       // Handle popping tasks
+	http.HandleFunc("/stream", streamTaskHandler) // Handle streaming tasks via SSE
+	http.HandleFunc("/ack", ackTaskHandler)       // Handle acking a leased task
+	http.HandleFunc("/nack", nackTaskHandler)     // Handle nacking a leased task
+	http.HandleFunc("/dlq", dlqHandler)           // Handle inspecting the dead-letter queue
+	http.HandleFunc("/peek", peekHandler)         // Handle reporting queue depth
 
 	log.Println("Starting queue service on :8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil))
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncRecorder is an http.ResponseWriter/http.Flusher safe for concurrent
+// use, needed because streamTaskHandler writes from its own goroutine
+// while a test reads the buffered output to watch for events arriving.
+type syncRecorder struct {
+	mu   sync.Mutex
+	code int
+	buf  bytes.Buffer
+}
+
+func newSyncRecorder() *syncRecorder { return &syncRecorder{} }
+
+func (r *syncRecorder) Header() http.Header { return make(http.Header) }
+
+func (r *syncRecorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Write(b)
+}
+
+func (r *syncRecorder) WriteHeader(code int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.code = code
+}
+
+func (r *syncRecorder) Flush() {}
+
+func (r *syncRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.String()
+}
+
+func TestPopWaitUnblocksImmediatelyOnPush(t *testing.T) {
+	manager = NewQueueManager()
+	defer func() { manager = nil }()
+
+	req := httptest.NewRequest(http.MethodGet, "/pop?queue=w&wait=2s", nil)
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	done := make(chan time.Duration, 1)
+	go func() {
+		popTaskHandler(rec, req)
+		done <- time.Since(start)
+	}()
+
+	time.Sleep(50 * time.Millisecond) // let the handler start waiting
+	if err := manager.PushTo("w", Task{Body: "x", Priority: "high"}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	select {
+	case elapsed := <-done:
+		if elapsed > 500*time.Millisecond {
+			t.Fatalf("pop took %v to unblock after push, want near-instant", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("popTaskHandler never returned")
+	}
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body=%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
+
+func TestPopWaitTimesOutWithNoContent(t *testing.T) {
+	manager = NewQueueManager()
+	defer func() { manager = nil }()
+
+	req := httptest.NewRequest(http.MethodGet, "/pop?queue=empty&wait=30ms", nil)
+	rec := httptest.NewRecorder()
+	popTaskHandler(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+// TestPopWaitManyWaitersAgainstRacingPushes races N concurrent long-poll
+// waiters against N concurrent pushes on the same queue (run with -race),
+// the scenario the lost-wakeup bug in Queue.PopWait surfaced under.
+func TestPopWaitManyWaitersAgainstRacingPushes(t *testing.T) {
+	manager = NewQueueManager()
+	defer func() { manager = nil }()
+
+	const n = 20
+	statuses := make([]int, n)
+	var waiters sync.WaitGroup
+	waiters.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer waiters.Done()
+			req := httptest.NewRequest(http.MethodGet, "/pop?queue=race&wait=2s", nil)
+			rec := httptest.NewRecorder()
+			popTaskHandler(rec, req)
+			statuses[i] = rec.Code
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond) // let the waiters start blocking
+
+	var pushers sync.WaitGroup
+	pushers.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer pushers.Done()
+			if err := manager.PushTo("race", Task{Body: "x", Priority: "high"}); err != nil {
+				t.Errorf("push: %v", err)
+			}
+		}()
+	}
+	pushers.Wait()
+
+	done := make(chan struct{})
+	go func() { waiters.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not every waiter unblocked")
+	}
+
+	for i, code := range statuses {
+		if code != http.StatusOK {
+			t.Fatalf("waiter %d got status %d, want %d", i, code, http.StatusOK)
+		}
+	}
+}
+
+func TestStreamTaskHandlerEmitsSSEEvent(t *testing.T) {
+	manager = NewQueueManager()
+	defer func() { manager = nil }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/stream?queue=s", nil).WithContext(ctx)
+	rec := newSyncRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		streamTaskHandler(rec, req)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond) // let the handler start waiting
+	if err := manager.PushTo("s", Task{Body: "hello", Priority: "high"}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(rec.String(), `"hello"`) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !strings.Contains(rec.String(), `"hello"`) {
+		t.Fatalf("expected an SSE event containing the pushed task, got body=%q", rec.String())
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("streamTaskHandler did not return after context cancellation")
+	}
+}
+
+func TestStreamTaskHandlerStopsPromptlyOnCancel(t *testing.T) {
+	manager = NewQueueManager()
+	defer func() { manager = nil }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/stream?queue=cancel-me", nil).WithContext(ctx)
+	rec := newSyncRecorder()
+
+	start := time.Now()
+	done := make(chan time.Duration, 1)
+	go func() {
+		streamTaskHandler(rec, req)
+		done <- time.Since(start)
+	}()
+
+	time.Sleep(20 * time.Millisecond) // let it start blocking in PopWait
+	cancel()
+
+	select {
+	case elapsed := <-done:
+		if elapsed > 500*time.Millisecond {
+			t.Fatalf("streamTaskHandler took %v to stop after cancel, want near-instant", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("streamTaskHandler did not return after context cancellation")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemStore is the default Store: everything lives in process memory, in
+// the same *Queue type the package has always used, so it's lost on
+// restart. It's also the only Store that supports the DeadLetterLister
+// capability, since the Store interface itself has no way to list DLQ
+// contents (only count them via Stats).
+type MemStore struct {
+	mu     sync.Mutex
+	queues map[string]*Queue
+}
+
+// NewMemStore creates an empty in-memory store.
+func NewMemStore() *MemStore {
+	return &MemStore{queues: make(map[string]*Queue)}
+}
+
+func (s *MemStore) getOrCreate(queueName string) *Queue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.queues[queueName]; !exists {
+		s.queues[queueName] = NewQueue()
+	}
+	return s.queues[queueName]
+}
+
+func (s *MemStore) Push(queueName string, task Task) error {
+	return s.getOrCreate(queueName).Push(task)
+}
+
+func (s *MemStore) Pop(queueName string) (*Task, string, error) {
+	task, lease := s.getOrCreate(queueName).Pop()
+	return task, lease, nil
+}
+
+func (s *MemStore) Ack(queueName, lease string) error {
+	if !s.getOrCreate(queueName).Ack(lease) {
+		return ErrUnknownLease
+	}
+	return nil
+}
+
+func (s *MemStore) Nack(queueName, lease string) error {
+	if !s.getOrCreate(queueName).Nack(lease) {
+		return ErrUnknownLease
+	}
+	return nil
+}
+
+func (s *MemStore) Schedule(queueName string, task Task, eta time.Time) error {
+	s.getOrCreate(queueName).Schedule(task, eta)
+	return nil
+}
+
+func (s *MemStore) ListQueues() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.queues))
+	for name := range s.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemStore) Stats(queueName string) (PeekStats, error) {
+	return s.getOrCreate(queueName).Peek(), nil
+}
+
+// DeadLetters implements the optional DeadLetterLister capability so
+// /dlq can return full task bodies when running on MemStore.
+func (s *MemStore) DeadLetters(queueName string) ([]Task, error) {
+	return s.getOrCreate(queueName).DeadLetters(), nil
+}
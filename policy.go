@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policy decides which queue QueueManager.Pop serves next. Implementations
+// must be safe for concurrent use.
+type Policy interface {
+	// pop selects a ready task across the manager's queues, returning the
+	// task, the name of the queue it came from, and its lease token. It
+	// returns a nil task if nothing is ready right now.
+	pop(qm *QueueManager) (task *Task, queueName string, lease string)
+}
+
+// strictPriorityPolicy consults queues in a fixed order, returning the
+// first ready task it finds.
+type strictPriorityPolicy struct {
+	order []string
+}
+
+// StrictPriority returns a Policy that always drains queues in the given
+// order: a task is only popped from order[i] once order[0..i-1] have
+// nothing ready.
+func StrictPriority(order []string) Policy {
+	return &strictPriorityPolicy{order: order}
+}
+
+func (p *strictPriorityPolicy) pop(qm *QueueManager) (*Task, string, string) {
+	for _, name := range p.order {
+		if task, lease, _ := qm.store.Pop(name); task != nil {
+			return task, name, lease
+		}
+	}
+	return nil, "", ""
+}
+
+// weightedPolicy distributes pops across queues proportional to their
+// weight using smooth weighted round robin: each queue accrues its weight
+// as credit every round, the highest-credit ready queue is served, and
+// that queue's credit is debited by the round's total weight. Credit a
+// queue doesn't spend (because it had nothing ready) carries over, so it
+// catches up once work arrives.
+type weightedPolicy struct {
+	mu     sync.Mutex
+	names  []string
+	weight map[string]int
+	credit map[string]int
+}
+
+// Weighted returns a Policy that gives each named queue a share of pops
+// proportional to its weight. Queues not present in weights are never
+// served by this policy.
+func Weighted(weights map[string]uint) Policy {
+	names := make([]string, 0, len(weights))
+	weight := make(map[string]int, len(weights))
+	for name, w := range weights {
+		if w == 0 {
+			w = 1
+		}
+		names = append(names, name)
+		weight[name] = int(w)
+	}
+	sort.Strings(names) // deterministic iteration order for tie-breaking
+
+	return &weightedPolicy{
+		names:  names,
+		weight: weight,
+		credit: make(map[string]int, len(names)),
+	}
+}
+
+func (p *weightedPolicy) pop(qm *QueueManager) (*Task, string, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := 0
+	candidates := make([]string, len(p.names))
+	copy(candidates, p.names)
+	for _, name := range p.names {
+		p.credit[name] += p.weight[name]
+		total += p.weight[name]
+	}
+
+	for len(candidates) > 0 {
+		best := 0
+		for i := 1; i < len(candidates); i++ {
+			if p.credit[candidates[i]] > p.credit[candidates[best]] {
+				best = i
+			}
+		}
+		name := candidates[best]
+		if task, lease, _ := qm.store.Pop(name); task != nil {
+			p.credit[name] -= total
+			return task, name, lease
+		}
+		// Nothing ready there right now; its credit is left intact (so it
+		// carries over) but it's out of the running for this particular pop.
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+	return nil, "", ""
+}
+
+// SetPolicy changes how QueueManager.Pop orders queues against each other.
+func (qm *QueueManager) SetPolicy(policy Policy) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	qm.policy = policy
+}
+
+// Pop pulls the next ready task across all managed queues according to the
+// configured Policy (StrictPriority over queue-creation order, by default).
+// The returned queue name and lease are needed to later Ack or Nack it.
+func (qm *QueueManager) Pop() (task *Task, queueName string, lease string) {
+	qm.mu.RLock()
+	policy := qm.policy
+	qm.mu.RUnlock()
+
+	if policy == nil {
+		policy = StrictPriority(qm.QueueNames())
+	}
+	return policy.pop(qm)
+}
+
+// Ack acks a task previously popped from queueName via QueueManager.Pop.
+func (qm *QueueManager) Ack(queueName, lease string) error {
+	return qm.store.Ack(queueName, lease)
+}
+
+// Nack nacks a task previously popped from queueName via QueueManager.Pop.
+func (qm *QueueManager) Nack(queueName, lease string) error {
+	return qm.store.Nack(queueName, lease)
+}
+
+// Autopop starts a goroutine that continuously pops tasks according to the
+// manager's Policy and emits them on the returned channel, which is closed
+// once ctx is canceled. It lets a consumer `range` over work without
+// polling /pop itself; since each Task is delivered without its lease, it
+// is acked immediately on pop so its in-flight entry and any dedup
+// reservation are released right away, suiting fire-and-forget consumers
+// that can't resolve a lease of their own.
+func (qm *QueueManager) Autopop(ctx context.Context) <-chan Task {
+	out := make(chan Task)
+
+	go func() {
+		defer close(out)
+		for {
+			task, queueName, lease := qm.Pop()
+			if task == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(pollInterval):
+				}
+				continue
+			}
+			qm.Ack(queueName, lease)
+
+			select {
+			case out <- *task:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
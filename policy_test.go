@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStrictPriorityDrainsQueuesInOrder(t *testing.T) {
+	qm := NewQueueManager()
+	qm.SetPolicy(StrictPriority([]string{"a", "b"}))
+
+	if err := qm.PushTo("b", Task{Body: "b1", Priority: "high"}); err != nil {
+		t.Fatalf("push b1: %v", err)
+	}
+	if err := qm.PushTo("a", Task{Body: "a1", Priority: "high"}); err != nil {
+		t.Fatalf("push a1: %v", err)
+	}
+
+	// "a" precedes "b" in the order, so it must drain first even though
+	// "b1" was pushed earlier.
+	task, queueName, _ := qm.Pop()
+	if task == nil || queueName != "a" || task.Body != "a1" {
+		t.Fatalf("expected a1 from queue a, got %+v from %q", task, queueName)
+	}
+
+	task, queueName, _ = qm.Pop()
+	if task == nil || queueName != "b" || task.Body != "b1" {
+		t.Fatalf("expected b1 from queue b, got %+v from %q", task, queueName)
+	}
+
+	if task, _, _ := qm.Pop(); task != nil {
+		t.Fatalf("expected no more tasks, got %+v", task)
+	}
+}
+
+func TestWeightedSplitsPopsProportionally(t *testing.T) {
+	qm := NewQueueManager()
+	qm.SetPolicy(Weighted(map[string]uint{"a": 2, "b": 1}))
+
+	// Keep both queues well-stocked throughout the run, so the sampled
+	// window below measures the policy's steady-state ratio rather than
+	// one queue draining before the other.
+	const perQueue = 1000
+	for i := 0; i < perQueue; i++ {
+		if err := qm.PushTo("a", Task{Body: "x", Priority: "high"}); err != nil {
+			t.Fatalf("push to a: %v", err)
+		}
+		if err := qm.PushTo("b", Task{Body: "x", Priority: "high"}); err != nil {
+			t.Fatalf("push to b: %v", err)
+		}
+	}
+
+	const sample = 300
+	counts := map[string]int{}
+	for i := 0; i < sample; i++ {
+		task, queueName, _ := qm.Pop()
+		if task == nil {
+			t.Fatalf("expected a task on pop %d", i)
+		}
+		counts[queueName]++
+	}
+
+	// Weight 2:1 with both queues always ready should land close to a 2:1
+	// split of pops; allow slack for the carry-over credit mechanic.
+	ratio := float64(counts["a"]) / float64(counts["b"])
+	if ratio < 1.7 || ratio > 2.3 {
+		t.Fatalf("expected roughly a 2:1 a:b pop split, got a=%d b=%d (ratio %.2f)", counts["a"], counts["b"], ratio)
+	}
+}
+
+func TestAutopopDrainsAndStopsOnCancel(t *testing.T) {
+	qm := NewQueueManager()
+	for i := 0; i < 3; i++ {
+		if err := qm.PushTo("q", Task{Body: "x", Priority: "high"}); err != nil {
+			t.Fatalf("push: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := qm.Autopop(ctx)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case task, ok := <-out:
+			if !ok {
+				t.Fatalf("channel closed early after %d tasks", i)
+			}
+			if task.Body != "x" {
+				t.Fatalf("unexpected task body: %q", task.Body)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for task %d", i)
+		}
+	}
+
+	cancel()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("expected the channel to be closed after cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Autopop's channel to close after cancel")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Handler processes a single task popped from a queue. Returning an error
+// nacks the task (triggering the retry/DLQ path); returning nil acks it.
+type Handler func(ctx context.Context, task Task) error
+
+// ProcessorOptions configures QueueManager.Run.
+type ProcessorOptions struct {
+	// Concurrency bounds the number of handler invocations in flight at
+	// once, across all queues. Defaults to 1.
+	Concurrency int
+
+	// QueueWeights gives registered queues relative shares of the
+	// processor's attention; a queue with weight 2 is polled twice as
+	// often as one with weight 1. Queues without an entry default to 1.
+	QueueWeights map[string]int
+}
+
+const pollInterval = 20 * time.Millisecond
+
+// Handle registers the handler that should process tasks popped from
+// queueName once Run is called. Registering again for the same queue
+// replaces the previous handler.
+func (qm *QueueManager) Handle(queueName string, handler Handler) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if qm.handlers == nil {
+		qm.handlers = make(map[string]Handler)
+	}
+	qm.handlers[queueName] = handler
+}
+
+// RegisterType associates a task payload type name with a Go type, so Run
+// can decode a task's JSON body into a fresh instance of proto's type
+// before handing the task to its handler (via Task.Payload). proto may be
+// passed either as a value (Demo{}) or a pointer (&Demo{}), mirroring
+// gob.Register; either way, Task.Payload is always a *Demo, never **Demo.
+func (qm *QueueManager) RegisterType(name string, proto any) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if qm.payloadTypes == nil {
+		qm.payloadTypes = make(map[string]reflect.Type)
+	}
+	t := reflect.TypeOf(proto)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	qm.payloadTypes[name] = t
+}
+
+// decodePayload fills task.Payload from task.Body using the type
+// registered for task.Type, if any. Handlers that don't care about typed
+// payloads can ignore it and read task.Body directly.
+func (qm *QueueManager) decodePayload(task *Task) {
+	if task.Type == "" {
+		return
+	}
+
+	qm.mu.RLock()
+	t, ok := qm.payloadTypes[task.Type]
+	qm.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	ptr := reflect.New(t)
+	if err := json.Unmarshal([]byte(task.Body), ptr.Interface()); err != nil {
+		return
+	}
+	task.Payload = ptr.Interface()
+}
+
+// weightedQueueOrderLocked returns the queues with a registered handler,
+// each repeated according to its weight, for round-robin polling. Callers
+// must hold qm.mu (for read).
+func (qm *QueueManager) weightedQueueOrderLocked(weights map[string]int) []string {
+	var order []string
+	for queueName := range qm.handlers {
+		weight := weights[queueName]
+		if weight <= 0 {
+			weight = 1
+		}
+		for i := 0; i < weight; i++ {
+			order = append(order, queueName)
+		}
+	}
+	return order
+}
+
+// Run polls every queue with a registered handler and dispatches popped
+// tasks to their handlers, honoring opts.Concurrency in-flight and
+// opts.QueueWeights for relative polling frequency. It blocks until ctx is
+// canceled, then waits for in-flight handlers to finish before returning
+// ctx.Err().
+func (qm *QueueManager) Run(ctx context.Context, opts ProcessorOptions) error {
+	qm.mu.RLock()
+	order := qm.weightedQueueOrderLocked(opts.QueueWeights)
+	qm.mu.RUnlock()
+	if len(order) == 0 {
+		return errors.New("queuemanager: Run called with no registered handlers")
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := 0; ; i = (i + 1) % len(order) {
+		if ctx.Err() != nil {
+			wg.Wait()
+			return ctx.Err()
+		}
+
+		queueName := order[i]
+		task, lease, _ := qm.store.Pop(queueName)
+		if task == nil {
+			if i == len(order)-1 {
+				select {
+				case <-ctx.Done():
+					wg.Wait()
+					return ctx.Err()
+				case <-time.After(pollInterval):
+				}
+			}
+			continue
+		}
+
+		qm.decodePayload(task)
+
+		qm.mu.RLock()
+		handler := qm.handlers[queueName]
+		qm.mu.RUnlock()
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(queueName string, task Task, lease string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := handler(ctx, task); err != nil {
+				qm.store.Nack(queueName, lease)
+				return
+			}
+			qm.store.Ack(queueName, lease)
+		}(queueName, *task, lease)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+type demoPayload struct {
+	Name string `json:"name"`
+}
+
+func TestRegisterTypeAcceptsValueOrPointerPrototype(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		proto any
+	}{
+		{"value prototype", demoPayload{}},
+		{"pointer prototype", &demoPayload{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			qm := NewQueueManager()
+			qm.RegisterType("demo", tc.proto)
+
+			task := &Task{Type: "demo", Body: `{"name":"widget"}`}
+			qm.decodePayload(task)
+
+			decoded, ok := task.Payload.(*demoPayload)
+			if !ok {
+				t.Fatalf("Payload is %T, want *demoPayload", task.Payload)
+			}
+			if decoded.Name != "widget" {
+				t.Fatalf("Name = %q, want %q", decoded.Name, "widget")
+			}
+		})
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RetryOptions controls how a failed task is retried before it is given up
+// on and moved to the dead-letter queue. The backoff schedule mirrors the
+// App Engine taskqueue retry model: delay doubles on every attempt up to
+// MaxDoublings, then stays flat at MaxBackoff.
+type RetryOptions struct {
+	RetryLimit   int           `json:"retry_limit,omitempty"`   // max attempts before DLQ; 0 means use defaultRetryLimit
+	MinBackoff   time.Duration `json:"min_backoff,omitempty"`   // delay before the first retry
+	MaxBackoff   time.Duration `json:"max_backoff,omitempty"`   // ceiling on the computed delay
+	AgeLimit     time.Duration `json:"age_limit,omitempty"`     // give up once the task is older than this, regardless of RetryLimit
+	MaxDoublings int           `json:"max_doublings,omitempty"` // number of times the backoff is allowed to double
+}
+
+const (
+	defaultRetryLimit   = 5
+	defaultMinBackoff   = 1 * time.Second
+	defaultMaxBackoff   = 5 * time.Minute
+	defaultMaxDoublings = 16
+)
+
+// withDefaults fills in zero-valued fields with the queue's defaults.
+func (r RetryOptions) withDefaults() RetryOptions {
+	if r.RetryLimit == 0 {
+		r.RetryLimit = defaultRetryLimit
+	}
+	if r.MinBackoff == 0 {
+		r.MinBackoff = defaultMinBackoff
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = defaultMaxBackoff
+	}
+	if r.MaxDoublings == 0 {
+		r.MaxDoublings = defaultMaxDoublings
+	}
+	return r
+}
+
+// backoff returns how long to wait before the given attempt (1-indexed) is
+// retried: min(MaxBackoff, MinBackoff * 2^min(attempt, MaxDoublings)).
+func (r RetryOptions) backoff(attempt int) time.Duration {
+	doublings := attempt
+	if doublings > r.MaxDoublings {
+		doublings = r.MaxDoublings
+	}
+	delay := r.MinBackoff * time.Duration(1<<uint(doublings))
+	if delay > r.MaxBackoff || delay <= 0 {
+		delay = r.MaxBackoff
+	}
+	return delay
+}
+
+type Task struct {
+	ID       string        `json:"id"`
+	Body     string        `json:"body"`
+	Priority string        `json:"priority"` // "low", "medium", "high"
+	Retry    *RetryOptions `json:"retry,omitempty"`
+
+	// ETA schedules the task for future delivery; it is not popped until
+	// that time. Delay is a convenience alternative that is resolved to an
+	// ETA of time.Now().Add(Delay) at push time. If both are set, ETA wins.
+	ETA   time.Time     `json:"eta,omitempty"`
+	Delay time.Duration `json:"delay,omitempty"`
+
+	// Type names a payload type registered via QueueManager.RegisterType.
+	// When set, Run decodes Body into a fresh instance of that type and
+	// makes it available to the handler as Payload.
+	Type    string `json:"type,omitempty"`
+	Payload any    `json:"-"`
+
+	// Name deduplicates pushes: while it is reserved by an earlier task
+	// (see Queue.Push and Queue.DedupTTL), pushing another task with the
+	// same Name fails with ErrTaskAlreadyAdded.
+	Name string `json:"name,omitempty"`
+
+	attempts  int
+	createdAt time.Time
+}
+
+// eta resolves the task's effective delivery time, or the zero Time if it
+// should be delivered immediately.
+func (t Task) eta() time.Time {
+	if !t.ETA.IsZero() {
+		return t.ETA
+	}
+	if t.Delay > 0 {
+		return time.Now().Add(t.Delay)
+	}
+	return time.Time{}
+}
+
+var taskIDCounter uint64
+
+func nextTaskID() string {
+	return strconv.FormatUint(atomic.AddUint64(&taskIDCounter, 1), 10)
+}
+
+var leaseCounter uint64
+
+func nextLease() string {
+	return "lease-" + strconv.FormatUint(atomic.AddUint64(&leaseCounter, 1), 10)
+}
+
+// leasedTask is a task that has been popped but not yet acked or nacked.
+type leasedTask struct {
+	task Task
+}
+
+// scheduledTask is a task that is not yet visible: either pushed with a
+// future ETA, or nacked and waiting out its backoff.
+type scheduledTask struct {
+	task Task
+	eta  time.Time
+}
+
+// schedHeap is a container/heap.Interface min-heap ordered by eta. A queue
+// keeps one per priority level so promotion preserves High/Medium/Low
+// ordering among tasks that become ready at the same time.
+type schedHeap []scheduledTask
+
+func (h schedHeap) Len() int            { return len(h) }
+func (h schedHeap) Less(i, j int) bool  { return h[i].eta.Before(h[j].eta) }
+func (h schedHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *schedHeap) Push(x interface{}) { *h = append(*h, x.(scheduledTask)) }
+func (h *schedHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// A single queue with priority levels
+type Queue struct {
+	High   []Task
+	Medium []Task
+	Low    []Task
+	mu     sync.Mutex
+
+	scheduledHigh   schedHeap
+	scheduledMedium schedHeap
+	scheduledLow    schedHeap
+
+	dlq      []Task
+	inFlight map[string]leasedTask
+
+	// DedupTTL overrides how long a completed task's Name is remembered to
+	// reject repushes; zero means defaultDedupTTL.
+	DedupTTL time.Duration
+	dedup    map[string]time.Time // name -> time it may be reused; zero Time means still in flight
+
+	// notify is closed and replaced every time a task becomes ready, so
+	// PopWait's waiters can block on it instead of polling.
+	notify chan struct{}
+}
+
+// NewQueue creates a queue and starts its background scheduler, which
+// promotes scheduled tasks (future ETA, or nacked-and-backing-off) into the
+// ready slices once they come due.
+func NewQueue() *Queue {
+	q := &Queue{notify: make(chan struct{})}
+	go q.schedulerLoop()
+	return q
+}
+
+// broadcastLocked wakes every PopWait call currently blocked on this
+// queue. Callers must hold q.mu.
+func (q *Queue) broadcastLocked() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// schedulerLoop periodically promotes due scheduled tasks so they become
+// poppable even if nothing is actively calling Pop.
+func (q *Queue) schedulerLoop() {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		q.mu.Lock()
+		q.promoteDueScheduledLocked()
+		q.mu.Unlock()
+	}
+}
+
+// ErrTaskAlreadyAdded is returned by Push when task.Name matches a task
+// pushed (and not yet forgotten) earlier, so at-least-once producers can
+// safely retry a push after a network error without double-enqueuing.
+var ErrTaskAlreadyAdded = errors.New("queue: task already added")
+
+// defaultDedupTTL is how long a completed task's Name is remembered after
+// completion, matching App Engine taskqueue's tombstoned-name retention.
+const defaultDedupTTL = 7 * 24 * time.Hour
+
+// Add a task to the queue based on its priority, or onto the scheduled
+// heap for its priority if it carries a future ETA/Delay. If task.Name is
+// set and still reserved by an earlier, not-yet-forgotten task,
+// ErrTaskAlreadyAdded is returned and the task is not enqueued.
+func (q *Queue) Push(task Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if task.ID == "" {
+		task.ID = nextTaskID()
+	}
+	if task.createdAt.IsZero() {
+		task.createdAt = time.Now()
+	}
+
+	if task.Name != "" {
+		if expiresAt, reserved := q.dedup[task.Name]; reserved && (expiresAt.IsZero() || time.Now().Before(expiresAt)) {
+			return ErrTaskAlreadyAdded
+		}
+		if q.dedup == nil {
+			q.dedup = make(map[string]time.Time)
+		}
+		q.dedup[task.Name] = time.Time{} // reserved until completion
+	}
+
+	if eta := task.eta(); eta.After(time.Now()) {
+		q.scheduleLocked(task, eta)
+		return nil
+	}
+	q.pushLocked(task)
+	return nil
+}
+
+// releaseDedupNameLocked marks name as completed, starting its TTL
+// countdown before it can be reused by a future Push. Callers must hold
+// q.mu.
+func (q *Queue) releaseDedupNameLocked(name string) {
+	if name == "" {
+		return
+	}
+	ttl := q.DedupTTL
+	if ttl == 0 {
+		ttl = defaultDedupTTL
+	}
+	q.dedup[name] = time.Now().Add(ttl)
+}
+
+// Schedule enqueues task to become ready at eta, regardless of any
+// ETA/Delay already set on it.
+func (q *Queue) Schedule(task Task, eta time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if task.ID == "" {
+		task.ID = nextTaskID()
+	}
+	if task.createdAt.IsZero() {
+		task.createdAt = time.Now()
+	}
+	q.scheduleLocked(task, eta)
+}
+
+// scheduleLocked places task onto the scheduled heap matching its
+// priority. Callers must hold q.mu.
+func (q *Queue) scheduleLocked(task Task, eta time.Time) {
+	st := scheduledTask{task: task, eta: eta}
+	switch task.Priority {
+	case "high":
+		heap.Push(&q.scheduledHigh, st)
+	case "medium":
+		heap.Push(&q.scheduledMedium, st)
+	default:
+		heap.Push(&q.scheduledLow, st)
+	}
+}
+
+func (q *Queue) pushLocked(task Task) {
+	if task.ID == "" {
+		task.ID = nextTaskID()
+	}
+	if task.createdAt.IsZero() {
+		task.createdAt = time.Now()
+	}
+
+	// Default priority is "low"
+	switch task.Priority {
+	case "high":
+		q.High = append(q.High, task)
+	case "medium":
+		q.Medium = append(q.Medium, task)
+	default:
+		q.Low = append(q.Low, task)
+	}
+	q.broadcastLocked()
+}
+
+// Pop removes the highest-priority ready task and leases it to the caller.
+// The returned lease token must be passed to Ack or Nack to resolve it.
+func (q *Queue) Pop() (*Task, string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.popLocked()
+}
+
+func (q *Queue) popLocked() (*Task, string) {
+	q.promoteDueScheduledLocked()
+
+	var task *Task
+	if len(q.High) > 0 {
+		t := q.High[0]
+		q.High = q.High[1:]
+		task = &t
+	} else if len(q.Medium) > 0 {
+		t := q.Medium[0]
+		q.Medium = q.Medium[1:]
+		task = &t
+	} else if len(q.Low) > 0 {
+		t := q.Low[0]
+		q.Low = q.Low[1:]
+		task = &t
+	}
+	if task == nil {
+		return nil, ""
+	}
+
+	lease := nextLease()
+	if q.inFlight == nil {
+		q.inFlight = make(map[string]leasedTask)
+	}
+	q.inFlight[lease] = leasedTask{task: *task}
+	return task, lease
+}
+
+// PopWait behaves like Pop, but if nothing is ready it blocks until a push
+// makes something ready, timeout elapses, or ctx is canceled, whichever
+// comes first. It returns a nil task (not an error) on timeout or
+// cancellation.
+func (q *Queue) PopWait(ctx context.Context, timeout time.Duration) (*Task, string) {
+	deadline := time.Now().Add(timeout)
+	for {
+		// Pop and capture the current notify channel under the same lock
+		// acquisition, so a push that lands between them can't close the
+		// channel we'd otherwise wait on without us seeing its task.
+		q.mu.Lock()
+		task, lease := q.popLocked()
+		ch := q.notify
+		q.mu.Unlock()
+		if task != nil {
+			return task, lease
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, ""
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return nil, ""
+		case <-time.After(remaining):
+			return nil, ""
+		}
+	}
+}
+
+// Ack confirms a leased task completed successfully, removing it from the
+// in-flight set for good.
+func (q *Queue) Ack(lease string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	leased, ok := q.inFlight[lease]
+	if !ok {
+		return false
+	}
+	delete(q.inFlight, lease)
+	q.releaseDedupNameLocked(leased.task.Name)
+	return true
+}
+
+// Nack reports that a leased task's execution failed. The task is
+// re-enqueued with an exponentially increasing backoff until RetryLimit or
+// AgeLimit is exceeded, at which point it is moved to the dead-letter queue.
+func (q *Queue) Nack(lease string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	leased, ok := q.inFlight[lease]
+	if !ok {
+		return false
+	}
+	delete(q.inFlight, lease)
+
+	task := leased.task
+	task.attempts++
+
+	opts := defaultRetryOptionsFor(task)
+	aged := opts.AgeLimit > 0 && time.Since(task.createdAt) > opts.AgeLimit
+	if task.attempts > opts.RetryLimit || aged {
+		q.dlq = append(q.dlq, task)
+		q.releaseDedupNameLocked(task.Name)
+		return true
+	}
+
+	q.scheduleLocked(task, time.Now().Add(opts.backoff(task.attempts)))
+	return true
+}
+
+// defaultRetryOptionsFor returns the task's retry options with defaults
+// applied, so tasks pushed without explicit RetryOptions still retry.
+func defaultRetryOptionsFor(task Task) RetryOptions {
+	if task.Retry == nil {
+		return RetryOptions{}.withDefaults()
+	}
+	return task.Retry.withDefaults()
+}
+
+// promoteDueScheduledLocked moves any scheduled task whose eta has elapsed,
+// across all three priority heaps, back into its ready slice. Callers must
+// hold q.mu.
+func (q *Queue) promoteDueScheduledLocked() {
+	now := time.Now()
+	for _, h := range []*schedHeap{&q.scheduledHigh, &q.scheduledMedium, &q.scheduledLow} {
+		for h.Len() > 0 && !(*h)[0].eta.After(now) {
+			st := heap.Pop(h).(scheduledTask)
+			q.pushLocked(st.task)
+		}
+	}
+}
+
+// DeadLetters returns a snapshot of the tasks this queue has given up on.
+func (q *Queue) DeadLetters() []Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make([]Task, len(q.dlq))
+	copy(out, q.dlq)
+	return out
+}
+
+// PriorityCounts breaks a count down by priority level.
+type PriorityCounts struct {
+	High   int `json:"high"`
+	Medium int `json:"medium"`
+	Low    int `json:"low"`
+}
+
+// PeekStats summarizes queue depth so operators can see how much work is
+// ready versus waiting on a future ETA or retry backoff.
+type PeekStats struct {
+	Ready      PriorityCounts `json:"ready"`
+	Scheduled  PriorityCounts `json:"scheduled"`
+	DeadLetter int            `json:"dead_letter"`
+}
+
+// Peek reports queue depth without popping anything.
+func (q *Queue) Peek() PeekStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.promoteDueScheduledLocked()
+	return PeekStats{
+		Ready: PriorityCounts{
+			High:   len(q.High),
+			Medium: len(q.Medium),
+			Low:    len(q.Low),
+		},
+		Scheduled: PriorityCounts{
+			High:   q.scheduledHigh.Len(),
+			Medium: q.scheduledMedium.Len(),
+			Low:    q.scheduledLow.Len(),
+		},
+		DeadLetter: len(q.dlq),
+	}
+}
+
+// Central queue manager that dispatches to every named queue's Store.
+type QueueManager struct {
+	store Store
+	mu    sync.RWMutex
+
+	handlers     map[string]Handler
+	payloadTypes map[string]reflect.Type
+	policy       Policy
+}
+
+// NewQueueManager creates a manager backed by an in-memory Store, or
+// whatever Store WithStore supplies.
+func NewQueueManager(opts ...Option) *QueueManager {
+	qm := &QueueManager{store: NewMemStore()}
+	for _, opt := range opts {
+		opt(qm)
+	}
+	return qm
+}
+
+// GetQueue returns the underlying *Queue for queueName. It only works when
+// the manager's Store is the default MemStore — it's a convenience escape
+// hatch for callers that want the concrete type, not a general Store API,
+// and returns nil for any other Store.
+func (qm *QueueManager) GetQueue(queueName string) *Queue {
+	ms, ok := qm.store.(*MemStore)
+	if !ok {
+		return nil
+	}
+	return ms.getOrCreate(queueName)
+}
+
+// QueueNames returns the names of all queues created so far, sorted for
+// deterministic default ordering.
+func (qm *QueueManager) QueueNames() []string {
+	names, _ := qm.store.ListQueues()
+	return names
+}
+
+// PushTo enqueues task onto queueName via the manager's Store.
+func (qm *QueueManager) PushTo(queueName string, task Task) error {
+	return qm.store.Push(queueName, task)
+}
+
+// PopFrom pops the next ready task from queueName via the manager's Store.
+func (qm *QueueManager) PopFrom(queueName string) (*Task, string, error) {
+	return qm.store.Pop(queueName)
+}
+
+// Stats reports queue depth for queueName via the manager's Store.
+func (qm *QueueManager) Stats(queueName string) (PeekStats, error) {
+	return qm.store.Stats(queueName)
+}
+
+// DeadLetterLister is implemented by Stores (currently only MemStore) that
+// can return full dead-lettered task bodies rather than just a count.
+type DeadLetterLister interface {
+	DeadLetters(queueName string) ([]Task, error)
+}
+
+// DeadLetters returns the dead-lettered tasks for queueName, if the
+// manager's Store supports listing them.
+func (qm *QueueManager) DeadLetters(queueName string) ([]Task, bool, error) {
+	lister, ok := qm.store.(DeadLetterLister)
+	if !ok {
+		return nil, false, nil
+	}
+	tasks, err := lister.DeadLetters(queueName)
+	return tasks, true, err
+}
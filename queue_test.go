@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNackRetriesWithBackoffThenDeadLetters(t *testing.T) {
+	q := NewQueue()
+	retry := RetryOptions{RetryLimit: 1, MinBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	if err := q.Push(Task{Body: "x", Priority: "high", Retry: &retry}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	task, lease := q.Pop()
+	if task == nil {
+		t.Fatal("expected a task to be poppable")
+	}
+	if ok := q.Nack(lease); !ok {
+		t.Fatal("nack of a valid lease should succeed")
+	}
+
+	// First nack is within RetryLimit: rescheduled with backoff, not yet
+	// given up on.
+	if dead := q.DeadLetters(); len(dead) != 0 {
+		t.Fatalf("expected no dead letters yet, got %d", len(dead))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	var retried *Task
+	var retriedLease string
+	for retried == nil && time.Now().Before(deadline) {
+		retried, retriedLease = q.Pop()
+		if retried == nil {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	if retried == nil {
+		t.Fatal("retried task never became ready after its backoff")
+	}
+
+	// Second nack exceeds RetryLimit: should move to the dead-letter queue.
+	if ok := q.Nack(retriedLease); !ok {
+		t.Fatal("nack of a valid lease should succeed")
+	}
+	dead := q.DeadLetters()
+	if len(dead) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(dead))
+	}
+	if dead[0].Body != "x" {
+		t.Fatalf("unexpected dead letter body: %q", dead[0].Body)
+	}
+}
+
+func TestNackUnknownLease(t *testing.T) {
+	q := NewQueue()
+	if ok := q.Nack("no-such-lease"); ok {
+		t.Fatal("expected nack of an unknown lease to fail")
+	}
+}
+
+func TestPushDedupRejectsUntilTTLExpires(t *testing.T) {
+	q := NewQueue()
+	q.DedupTTL = 20 * time.Millisecond
+
+	task := Task{Body: "x", Priority: "high", Name: "dup"}
+	if err := q.Push(task); err != nil {
+		t.Fatalf("first push: %v", err)
+	}
+	if err := q.Push(task); !errors.Is(err, ErrTaskAlreadyAdded) {
+		t.Fatalf("expected ErrTaskAlreadyAdded while the name is still in the queue, got %v", err)
+	}
+
+	popped, lease := q.Pop()
+	if popped == nil {
+		t.Fatal("expected the first push to be poppable")
+	}
+	if err := q.Push(task); !errors.Is(err, ErrTaskAlreadyAdded) {
+		t.Fatalf("expected ErrTaskAlreadyAdded while leased, got %v", err)
+	}
+
+	if ok := q.Ack(lease); !ok {
+		t.Fatal("ack of a valid lease should succeed")
+	}
+	if err := q.Push(task); !errors.Is(err, ErrTaskAlreadyAdded) {
+		t.Fatalf("expected ErrTaskAlreadyAdded immediately after ack, before the TTL expires, got %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := q.Push(task); err != nil {
+		t.Fatalf("expected push to succeed once the dedup TTL has expired, got %v", err)
+	}
+}
+
+func TestPushDelayDefersVisibilityUntilScheduler(t *testing.T) {
+	q := NewQueue()
+	if err := q.Push(Task{Body: "x", Priority: "high", Delay: 30 * time.Millisecond}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	if task, _ := q.Pop(); task != nil {
+		t.Fatal("expected the delayed task not to be poppable yet")
+	}
+	if stats := q.Peek(); stats.Scheduled.High != 1 || stats.Ready.High != 0 {
+		t.Fatalf("expected 1 scheduled / 0 ready high-priority task, got %+v", stats)
+	}
+
+	// Wait past the delay and the scheduler's own tick so the task is
+	// promoted without us calling Pop/Peek to force it.
+	time.Sleep(100 * time.Millisecond)
+
+	if stats := q.Peek(); stats.Scheduled.High != 0 || stats.Ready.High != 1 {
+		t.Fatalf("expected 0 scheduled / 1 ready high-priority task after the delay, got %+v", stats)
+	}
+
+	task, _ := q.Pop()
+	if task == nil || task.Body != "x" {
+		t.Fatalf("expected to pop the delayed task, got %+v", task)
+	}
+}
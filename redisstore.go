@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RedisStore is a Store backed by Redis, so tasks survive a process
+// restart and multiple instances can share the same queues. It keeps
+// ready tasks in per-priority lists, scheduled/retrying tasks in a sorted
+// set keyed by their eta, and in-flight leases as plain keys, following
+// the same layout asynq's rdb package uses for its task state.
+//
+// There's no official Redis client in this module's dependency-free
+// build, so RedisStore speaks RESP directly over a single connection
+// guarded by a mutex; it's built for correctness over throughput.
+type RedisStore struct {
+	addr string
+
+	// DedupTTL overrides how long a completed task's Name is remembered to
+	// reject repushes; zero means defaultDedupTTL. Mirrors Queue.DedupTTL.
+	DedupTTL time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewRedisStore returns a Store that talks to the Redis instance at addr
+// (e.g. "localhost:6379"). The connection is established lazily, on first
+// use.
+func NewRedisStore(addr string) *RedisStore {
+	return &RedisStore{addr: addr}
+}
+
+func (s *RedisStore) connLocked() (net.Conn, *bufio.Reader, error) {
+	if s.conn != nil {
+		return s.conn, s.r, nil
+	}
+	conn, err := net.DialTimeout("tcp", s.addr, 5*time.Second)
+	if err != nil {
+		return nil, nil, fmt.Errorf("redisstore: dial %s: %w", s.addr, err)
+	}
+	s.conn = conn
+	s.r = bufio.NewReader(conn)
+	return s.conn, s.r, nil
+}
+
+// do sends a RESP-encoded command and returns its parsed reply. Callers
+// hold s.mu for the duration of the round trip, so a single RedisStore
+// sends one command at a time.
+func (s *RedisStore) do(args ...string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conn, r, err := s.connLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write(encodeRESPCommand(args)); err != nil {
+		s.conn = nil // force a reconnect next time
+		return nil, fmt.Errorf("redisstore: write: %w", err)
+	}
+
+	reply, err := readRESPReply(r)
+	if err != nil {
+		s.conn = nil
+		return nil, fmt.Errorf("redisstore: read reply: %w", err)
+	}
+	return reply, nil
+}
+
+// encodeRESPCommand renders args as a RESP array of bulk strings, the
+// wire format Redis expects for commands.
+func encodeRESPCommand(args []string) []byte {
+	buf := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		buf = append(buf, fmt.Sprintf("$%d\r\n", len(arg))...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// readRESPReply parses one RESP reply: a Go string for simple/bulk
+// strings, int64 for integers, []any for arrays, nil for a null bulk
+// string/array, or an error for an error reply.
+func readRESPReply(r *bufio.Reader) (any, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("redisstore: empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redisstore: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil // nil bulk string
+		}
+		buf := make([]byte, n+2) // payload + trailing CRLF
+		if _, err := readFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil // nil array
+		}
+		items := make([]any, n)
+		for i := range items {
+			items[i], err = readRESPReply(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redisstore: unexpected reply prefix %q", line[0])
+	}
+}
+
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	// Trim the trailing "\r\n".
+	return line[:len(line)-2], nil
+}
+
+func readFull(r *bufio.Reader, buf []byte) (int, error) {
+	total := 0
+	for total < len(buf) {
+		n, err := r.Read(buf[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Redis key helpers. Queue state lives entirely under keys namespaced by
+// queue name so one Redis instance can back many queues.
+func readyKey(queueName, priority string) string { return "queue:" + queueName + ":ready:" + priority }
+func scheduledKey(queueName, priority string) string {
+	return "queue:" + queueName + ":scheduled:" + priority
+}
+func dlqKey(queueName string) string          { return "queue:" + queueName + ":dlq" }
+func leaseKey(queueName, lease string) string { return "queue:" + queueName + ":lease:" + lease }
+func dedupKey(queueName, name string) string  { return "queue:" + queueName + ":dedup:" + name }
+
+const queueSetKey = "queues"
+
+func priorityOf(task Task) string {
+	switch task.Priority {
+	case "high", "medium":
+		return task.Priority
+	default:
+		return "low"
+	}
+}
+
+func (s *RedisStore) rememberQueue(queueName string) error {
+	_, err := s.do("SADD", queueSetKey, queueName)
+	return err
+}
+
+func (s *RedisStore) Push(queueName string, task Task) error {
+	if task.ID == "" {
+		task.ID = nextTaskID()
+	}
+	if task.createdAt.IsZero() {
+		task.createdAt = time.Now()
+	}
+
+	if task.Name != "" {
+		// Two-phase dedup mirroring MemStore/Queue.DedupTTL: the name is
+		// reserved indefinitely (no TTL) from push until the task
+		// completes, at which point Ack/Nack's releaseDedup starts the
+		// TTL countdown. A task retrying past the TTL therefore can't
+		// have its name reused by a duplicate push while still in flight.
+		reply, err := s.do("SET", dedupKey(queueName, task.Name), "1", "NX")
+		if err != nil {
+			return err
+		}
+		if reply == nil {
+			return ErrTaskAlreadyAdded
+		}
+	}
+
+	if err := s.rememberQueue(queueName); err != nil {
+		return err
+	}
+
+	if eta := task.eta(); eta.After(time.Now()) {
+		return s.Schedule(queueName, task, eta)
+	}
+	return s.pushReady(queueName, task)
+}
+
+func (s *RedisStore) pushReady(queueName string, task Task) error {
+	body, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = s.do("RPUSH", readyKey(queueName, priorityOf(task)), string(body))
+	return err
+}
+
+func (s *RedisStore) Schedule(queueName string, task Task, eta time.Time) error {
+	if task.ID == "" {
+		task.ID = nextTaskID()
+	}
+	if task.createdAt.IsZero() {
+		task.createdAt = time.Now()
+	}
+
+	body, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	if err := s.rememberQueue(queueName); err != nil {
+		return err
+	}
+	_, err = s.do("ZADD", scheduledKey(queueName, priorityOf(task)), strconv.FormatInt(eta.UnixNano(), 10), string(body))
+	return err
+}
+
+// promoteDue moves every scheduled task whose eta has passed into its
+// ready list, one priority's sorted set at a time so scheduled depth can
+// still be broken down by priority (see Stats).
+func (s *RedisStore) promoteDue(queueName string) error {
+	for _, priority := range []string{"high", "medium", "low"} {
+		key := scheduledKey(queueName, priority)
+		reply, err := s.do("ZRANGEBYSCORE", key, "-inf", strconv.FormatInt(time.Now().UnixNano(), 10))
+		if err != nil {
+			return err
+		}
+		items, _ := reply.([]any)
+		for _, item := range items {
+			body, _ := item.(string)
+			var task Task
+			if err := json.Unmarshal([]byte(body), &task); err != nil {
+				continue
+			}
+			if _, err := s.do("ZREM", key, body); err != nil {
+				return err
+			}
+			if err := s.pushReady(queueName, task); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *RedisStore) Pop(queueName string) (*Task, string, error) {
+	if err := s.promoteDue(queueName); err != nil {
+		return nil, "", err
+	}
+
+	for _, priority := range []string{"high", "medium", "low"} {
+		reply, err := s.do("LPOP", readyKey(queueName, priority))
+		if err != nil {
+			return nil, "", err
+		}
+		body, ok := reply.(string)
+		if !ok {
+			continue // empty list: nil reply
+		}
+
+		var task Task
+		if err := json.Unmarshal([]byte(body), &task); err != nil {
+			return nil, "", err
+		}
+
+		lease := nextLease()
+		if _, err := s.do("SET", leaseKey(queueName, lease), body); err != nil {
+			return nil, "", err
+		}
+		return &task, lease, nil
+	}
+	return nil, "", nil
+}
+
+// releaseDedup starts name's TTL countdown now that the task it belongs to
+// has completed (acked, or given up on into the DLQ), mirroring
+// Queue.releaseDedupNameLocked.
+func (s *RedisStore) releaseDedup(queueName, name string) error {
+	if name == "" {
+		return nil
+	}
+	ttl := s.DedupTTL
+	if ttl == 0 {
+		ttl = defaultDedupTTL
+	}
+	_, err := s.do("PEXPIRE", dedupKey(queueName, name), strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (s *RedisStore) Ack(queueName, lease string) error {
+	reply, err := s.do("GET", leaseKey(queueName, lease))
+	if err != nil {
+		return err
+	}
+	body, ok := reply.(string)
+	if !ok {
+		return ErrUnknownLease
+	}
+	if _, err := s.do("DEL", leaseKey(queueName, lease)); err != nil {
+		return err
+	}
+
+	var task Task
+	if err := json.Unmarshal([]byte(body), &task); err != nil {
+		return err
+	}
+	return s.releaseDedup(queueName, task.Name)
+}
+
+func (s *RedisStore) Nack(queueName, lease string) error {
+	reply, err := s.do("GET", leaseKey(queueName, lease))
+	if err != nil {
+		return err
+	}
+	body, ok := reply.(string)
+	if !ok {
+		return ErrUnknownLease
+	}
+	if _, err := s.do("DEL", leaseKey(queueName, lease)); err != nil {
+		return err
+	}
+
+	var task Task
+	if err := json.Unmarshal([]byte(body), &task); err != nil {
+		return err
+	}
+	task.attempts++
+
+	opts := defaultRetryOptionsFor(task)
+	aged := opts.AgeLimit > 0 && time.Since(task.createdAt) > opts.AgeLimit
+	if task.attempts > opts.RetryLimit || aged {
+		out, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		if _, err := s.do("RPUSH", dlqKey(queueName), string(out)); err != nil {
+			return err
+		}
+		return s.releaseDedup(queueName, task.Name)
+	}
+
+	return s.Schedule(queueName, task, time.Now().Add(opts.backoff(task.attempts)))
+}
+
+func (s *RedisStore) ListQueues() ([]string, error) {
+	reply, err := s.do("SMEMBERS", queueSetKey)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]any)
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		if name, ok := item.(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (s *RedisStore) zcard(key string) (int, error) {
+	reply, err := s.do("ZCARD", key)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return int(n), nil
+}
+
+func (s *RedisStore) listLen(key string) (int, error) {
+	reply, err := s.do("LLEN", key)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return int(n), nil
+}
+
+func (s *RedisStore) Stats(queueName string) (PeekStats, error) {
+	if err := s.promoteDue(queueName); err != nil {
+		return PeekStats{}, err
+	}
+
+	high, err := s.listLen(readyKey(queueName, "high"))
+	if err != nil {
+		return PeekStats{}, err
+	}
+	medium, err := s.listLen(readyKey(queueName, "medium"))
+	if err != nil {
+		return PeekStats{}, err
+	}
+	low, err := s.listLen(readyKey(queueName, "low"))
+	if err != nil {
+		return PeekStats{}, err
+	}
+	dlqReply, err := s.do("LLEN", dlqKey(queueName))
+	if err != nil {
+		return PeekStats{}, err
+	}
+	dlqLen, _ := dlqReply.(int64)
+
+	scheduledHigh, err := s.zcard(scheduledKey(queueName, "high"))
+	if err != nil {
+		return PeekStats{}, err
+	}
+	scheduledMedium, err := s.zcard(scheduledKey(queueName, "medium"))
+	if err != nil {
+		return PeekStats{}, err
+	}
+	scheduledLow, err := s.zcard(scheduledKey(queueName, "low"))
+	if err != nil {
+		return PeekStats{}, err
+	}
+
+	return PeekStats{
+		Ready:      PriorityCounts{High: high, Medium: medium, Low: low},
+		Scheduled:  PriorityCounts{High: scheduledHigh, Medium: scheduledMedium, Low: scheduledLow},
+		DeadLetter: int(dlqLen),
+	}, nil
+}
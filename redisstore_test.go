@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRedisStoreRESPRoundTrip exercises RedisStore's RESP encoding/decoding
+// against a fake Redis speaking just enough of the protocol to reply, so
+// the wire format is verified without a real Redis instance.
+func TestRedisStoreRESPRoundTrip(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	store := &RedisStore{conn: clientConn, r: bufio.NewReader(clientConn)}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := bufio.NewReader(serverConn)
+		for {
+			reply, err := readRESPReply(r)
+			if err != nil {
+				return
+			}
+			args, _ := reply.([]any)
+			cmd := make([]string, len(args))
+			for i, a := range args {
+				cmd[i], _ = a.(string)
+			}
+
+			var resp string
+			switch cmd[0] {
+			case "RPUSH":
+				resp = ":1\r\n"
+			case "LLEN":
+				resp = ":3\r\n"
+			case "GET":
+				resp = "$-1\r\n" // nil bulk string
+			default:
+				resp = "+OK\r\n"
+			}
+			if _, err := serverConn.Write([]byte(resp)); err != nil {
+				return
+			}
+		}
+	}()
+
+	if reply, err := store.do("RPUSH", "queue:x:ready:high", `{"id":"1"}`); err != nil {
+		t.Fatalf("RPUSH: %v", err)
+	} else if n, _ := reply.(int64); n != 1 {
+		t.Fatalf("RPUSH: expected integer reply 1, got %v", reply)
+	}
+
+	if reply, err := store.do("LLEN", "queue:x:ready:high"); err != nil {
+		t.Fatalf("LLEN: %v", err)
+	} else if n, _ := reply.(int64); n != 3 {
+		t.Fatalf("LLEN: expected integer reply 3, got %v", reply)
+	}
+
+	if reply, err := store.do("GET", "queue:x:dedup:missing"); err != nil {
+		t.Fatalf("GET: %v", err)
+	} else if reply != nil {
+		t.Fatalf("GET: expected a nil bulk string reply, got %v", reply)
+	}
+
+	clientConn.Close()
+	serverConn.Close()
+	<-done
+}
+
+// TestRedisStorePushReservesDedupThenAckStartsTTL exercises the two-phase
+// dedup wire behavior from Push and Ack: the dedup key is reserved with a
+// bare "SET ... NX" (no expiry) at push time, and only gets a TTL, via
+// PEXPIRE, once the task completes — mirroring MemStore/Queue.DedupTTL.
+func TestRedisStorePushReservesDedupThenAckStartsTTL(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	store := &RedisStore{conn: clientConn, r: bufio.NewReader(clientConn), DedupTTL: 5 * time.Minute}
+
+	var mu sync.Mutex
+	var commands [][]string
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := bufio.NewReader(serverConn)
+		for {
+			reply, err := readRESPReply(r)
+			if err != nil {
+				return
+			}
+			args, _ := reply.([]any)
+			cmd := make([]string, len(args))
+			for i, a := range args {
+				cmd[i], _ = a.(string)
+			}
+
+			mu.Lock()
+			commands = append(commands, cmd)
+			mu.Unlock()
+
+			var resp string
+			switch cmd[0] {
+			case "GET":
+				resp = "$14\r\n{\"name\":\"dup\"}\r\n"
+			default:
+				resp = "+OK\r\n"
+			}
+			if _, err := serverConn.Write([]byte(resp)); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := store.Push("q", Task{Body: "x", Priority: "high", Name: "dup"}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if err := store.Ack("q", "lease-1"); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+
+	clientConn.Close()
+	serverConn.Close()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var setArgs, pexpireArgs []string
+	for _, cmd := range commands {
+		switch cmd[0] {
+		case "SET":
+			if len(cmd) >= 2 && cmd[1] == dedupKey("q", "dup") {
+				setArgs = cmd
+			}
+		case "PEXPIRE":
+			pexpireArgs = cmd
+		}
+	}
+
+	if setArgs == nil {
+		t.Fatal("expected Push to SET the dedup key")
+	}
+	for _, arg := range setArgs {
+		if arg == "PX" || arg == "EX" {
+			t.Fatalf("Push should reserve the dedup key with no TTL, got %v", setArgs)
+		}
+	}
+
+	if pexpireArgs == nil {
+		t.Fatal("expected Ack to PEXPIRE the dedup key")
+	}
+	if pexpireArgs[1] != dedupKey("q", "dup") {
+		t.Fatalf("PEXPIRE targeted %q, want %q", pexpireArgs[1], dedupKey("q", "dup"))
+	}
+	wantMS := strconv.FormatInt((5 * time.Minute).Milliseconds(), 10)
+	if pexpireArgs[2] != wantMS {
+		t.Fatalf("PEXPIRE ttl = %s, want %s", pexpireArgs[2], wantMS)
+	}
+}
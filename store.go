@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Store is the persistence backend behind a QueueManager. Every method is
+// addressed by queue name rather than a live *Queue, so callers (HTTP
+// handlers, the Processor, Policies) go through QueueManager and never
+// need to know which Store is plugged in underneath.
+type Store interface {
+	// Push enqueues task onto queueName, honoring task.ETA/Delay and
+	// task.Name dedup the same way Queue.Push does.
+	Push(queueName string, task Task) error
+
+	// Pop removes and leases the next ready task from queueName's
+	// priority ordering (high, then medium, then low). It returns a nil
+	// task if nothing is ready.
+	Pop(queueName string) (task *Task, lease string, err error)
+
+	// Ack resolves a leased task as successfully completed.
+	Ack(queueName, lease string) error
+
+	// Nack resolves a leased task as failed, applying its retry backoff
+	// or moving it to the dead-letter queue per its RetryOptions.
+	Nack(queueName, lease string) error
+
+	// Schedule enqueues task to become ready at eta, bypassing
+	// task.ETA/Delay (used internally for retry backoff, and available
+	// directly for callers that already know when they want it visible).
+	Schedule(queueName string, task Task, eta time.Time) error
+
+	// ListQueues returns the names of all queues known to the store.
+	ListQueues() ([]string, error)
+
+	// Stats reports queue depth for queueName.
+	Stats(queueName string) (PeekStats, error)
+}
+
+// ErrUnknownLease is returned by Ack/Nack when the lease is not (or is no
+// longer) outstanding.
+var ErrUnknownLease = errors.New("store: unknown or already resolved lease")
+
+// Option configures a QueueManager at construction time.
+type Option func(*QueueManager)
+
+// WithStore selects the persistence backend a QueueManager uses. The
+// default, used when no Option is given, is an in-memory Store.
+func WithStore(store Store) Option {
+	return func(qm *QueueManager) {
+		qm.store = store
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+// BenchmarkMemStorePushPop measures push/pop throughput against the
+// default in-memory Store.
+func BenchmarkMemStorePushPop(b *testing.B) {
+	benchmarkStorePushPop(b, NewMemStore())
+}
+
+// BenchmarkRedisStorePushPop measures the same workload against Redis, so
+// the cost of durability can be compared directly to MemStore. It needs a
+// reachable Redis (REDIS_ADDR, default localhost:6379) and skips itself
+// otherwise rather than failing the run.
+func BenchmarkRedisStorePushPop(b *testing.B) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		b.Skipf("no redis reachable at %s: %v", addr, err)
+	}
+	conn.Close()
+
+	benchmarkStorePushPop(b, NewRedisStore(addr))
+}
+
+func benchmarkStorePushPop(b *testing.B, store Store) {
+	const queueName = "bench"
+	task := Task{Body: "payload", Priority: "high"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.Push(queueName, task); err != nil {
+			b.Fatalf("push: %v", err)
+		}
+		popped, lease, err := store.Pop(queueName)
+		if err != nil {
+			b.Fatalf("pop: %v", err)
+		}
+		if popped == nil {
+			b.Fatal("expected a task immediately after pushing one")
+		}
+		if err := store.Ack(queueName, lease); err != nil {
+			b.Fatalf("ack: %v", err)
+		}
+	}
+}